@@ -0,0 +1,543 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultHistorySize bounds how many processed results EventLoop keeps around
+// for GET /events?since= replay and late SSE subscribers.
+const defaultHistorySize = 256
+
+// OnFullPolicy controls what dispatch does when the async queue has no room
+// left for a new event.
+type OnFullPolicy int
+
+const (
+	// Block makes dispatch wait until space frees up (or the loop stops).
+	Block OnFullPolicy = iota
+	// DropNewest silently discards the event being dispatched.
+	DropNewest
+	// DropOldest evicts the oldest queued event to make room for the new one.
+	DropOldest
+	// Error makes dispatch return ErrQueueFull instead of enqueueing.
+	Error
+)
+
+// ErrQueueFull is returned by dispatch when OnFull is Error and the queue is saturated.
+var ErrQueueFull = errors.New("eventloop: queue is full")
+
+// ErrStopped is returned by dispatch once the loop has been stopped.
+var ErrStopped = errors.New("eventloop: loop is stopped")
+
+// EventLoopOptions configures the worker pool backing an EventLoop.
+type EventLoopOptions struct {
+	Workers   int
+	QueueSize int
+	OnFull    OnFullPolicy
+
+	// Store durably logs every dispatched event so it can be redelivered if
+	// the process dies before the handler finishes. Defaults to an
+	// in-memory store, which gives at-least-once delivery only within the
+	// lifetime of the process.
+	Store EventStore
+
+	// Observers receive lifecycle callbacks for every event. A built-in
+	// MetricsCollector (see EventLoop.Metrics) is always registered first.
+	Observers []Observer
+}
+
+type Event struct {
+	Key     string
+	Data    string
+	IsAsync bool
+
+	// Priority breaks ties between events that are due at the same time;
+	// higher values run first. NotBefore holds the event back until that
+	// instant; the zero value means "as soon as possible".
+	Priority  int
+	NotBefore time.Time
+
+	// storeID is the EventStore ID this event was logged under, used to
+	// mark it processed once its handler finishes successfully. Zero means
+	// the event bypassed the store (e.g. a debug Replay).
+	storeID uint64
+}
+
+type EventResult struct {
+	ID     uint64    `json:"id"`
+	Key    string    `json:"key"`
+	Result string    `json:"result"`
+	Err    string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// Handler is the signature every event handler must implement. It receives a
+// context so middleware can enforce timeouts, retries and the like.
+type Handler func(ctx context.Context, data string) (string, error)
+
+// Middleware wraps a Handler to add cross-cutting behaviour such as
+// timeouts, retries or circuit breaking, without touching the handler itself.
+type Middleware func(next Handler) Handler
+
+// EventLoop dispatches events to registered handlers. Async events are queued
+// and processed by a pool of worker goroutines; sync events run inline on the
+// dispatching goroutine, matching the original blocking behaviour.
+type EventLoop struct {
+	handlersMu sync.RWMutex
+	handlers   map[string]Handler
+
+	heapMu       sync.Mutex
+	heapCond     *sync.Cond
+	pending      eventHeap
+	seq          uint64
+	wakeSchedule chan struct{}
+
+	ready   chan Event
+	results chan EventResult
+
+	store     EventStore
+	metrics   *MetricsCollector
+	observers []Observer
+	opts      EventLoopOptions
+
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+	stopped  chan struct{}
+	runOnce  sync.Once
+	started  chan struct{}
+
+	ctxMu   sync.RWMutex
+	baseCtx context.Context
+
+	// resultsMu guards everything publish() and Subscribe() touch together:
+	// history/nextID so Since() sees a consistent snapshot, and subs/nextSub
+	// so SubscribeSince can snapshot history and register its channel as one
+	// atomic step, with no window in which a result is both in the snapshot
+	// and delivered again on the channel.
+	resultsMu  sync.Mutex
+	nextID     uint64
+	history    []EventResult
+	historyCap int
+	subs       map[int]chan EventResult
+	nextSub    int
+}
+
+func NewEventLoop() *EventLoop {
+	return NewEventLoopWithOptions(EventLoopOptions{})
+}
+
+func NewEventLoopWithOptions(opts EventLoopOptions) *EventLoop {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 64
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryEventStore()
+	}
+	metrics := NewMetricsCollector()
+	e := &EventLoop{
+		handlers:     make(map[string]Handler),
+		wakeSchedule: make(chan struct{}, 1),
+		ready:        make(chan Event, opts.QueueSize),
+		results:      make(chan EventResult, opts.QueueSize),
+		store:        opts.Store,
+		metrics:      metrics,
+		observers:    append([]Observer{metrics}, opts.Observers...),
+		opts:         opts,
+		stopped:      make(chan struct{}),
+		started:      make(chan struct{}),
+		baseCtx:      context.Background(),
+		historyCap:   defaultHistorySize,
+		subs:         make(map[int]chan EventResult),
+	}
+	e.heapCond = sync.NewCond(&e.heapMu)
+	metrics.setQueueDepthFunc(e.QueueDepth)
+	e.replayUnprocessed()
+	return e
+}
+
+// QueueDepth returns the number of events currently waiting on the priority
+// heap for a free worker, i.e. not yet handed off to the ready channel.
+func (e *EventLoop) QueueDepth() int {
+	e.heapMu.Lock()
+	defer e.heapMu.Unlock()
+	return len(e.pending)
+}
+
+// Metrics returns a point-in-time snapshot of per-key counters, error rates
+// and handler-duration percentiles from the built-in MetricsCollector.
+func (e *EventLoop) Metrics() map[string]KeyStats {
+	return e.metrics.Snapshot()
+}
+
+func (e *EventLoop) notifyDispatch(event Event) {
+	for _, obs := range e.observers {
+		obs.OnDispatch(event)
+	}
+}
+
+func (e *EventLoop) notifyStart(event Event) {
+	for _, obs := range e.observers {
+		obs.OnStart(event)
+	}
+}
+
+func (e *EventLoop) notifyFinish(result EventResult, err error, dur time.Duration) {
+	for _, obs := range e.observers {
+		obs.OnFinish(result, err, dur)
+	}
+}
+
+func (e *EventLoop) notifyDrop(event Event, reason string) {
+	for _, obs := range e.observers {
+		obs.OnDrop(event, reason)
+	}
+}
+
+// replayUnprocessed loads events the store never saw marked processed
+// (e.g. the process died mid-flight) and re-queues them in ID order, so
+// restarting an EventLoop on top of a durable Store resumes outstanding work.
+// It runs synchronously inside the constructor, before Run has started any
+// worker to drain the heap, so it pushes straight onto the heap via
+// scheduleReplay instead of the bounded schedule(): going through schedule()
+// would apply QueueSize/OnFull backpressure with nothing around yet to
+// relieve it, and under the default Block policy would wait on heapCond
+// forever whenever the store has more unprocessed events than QueueSize.
+func (e *EventLoop) replayUnprocessed() {
+	pending, err := e.store.Unprocessed()
+	if err != nil {
+		fmt.Printf("eventloop: failed to load unprocessed events: %s\n", err)
+		return
+	}
+	for _, se := range pending {
+		event := se.Event
+		event.storeID = se.ID
+		event.IsAsync = true
+		e.scheduleReplay(event)
+	}
+}
+
+// The on() method populates the handlers fields with an identifier for a
+// given event and the code that should be executed in response to that
+// event. Middlewares are applied in the order given, so the first one wraps
+// all the others and runs first on the way in, last on the way out.
+func (e *EventLoop) on(key string, handler Handler, mws ...Middleware) *EventLoop {
+	for i := len(mws) - 1; i >= 0; i-- {
+		handler = mws[i](handler)
+	}
+	e.handlersMu.Lock()
+	e.handlers[key] = handler
+	e.handlersMu.Unlock()
+	return e
+}
+
+// dispatch submits event for execution, durably logging it to the Store
+// first so it can be redelivered if the process dies before the handler
+// finishes. Synchronous events with no delay are processed immediately on
+// the calling goroutine; everything else (async events, and any event with
+// a future NotBefore) is scheduled on the priority heap and handed to the
+// worker pool once due, subject to the configured OnFull policy when the
+// heap is full.
+func (e *EventLoop) dispatch(event Event) error {
+	select {
+	case <-e.stopped:
+		return ErrStopped
+	default:
+	}
+
+	id, err := e.store.Append(event)
+	if err != nil {
+		return fmt.Errorf("eventloop: failed to log event: %w", err)
+	}
+	event.storeID = id
+	e.notifyDispatch(event)
+
+	if !event.IsAsync && !event.NotBefore.After(time.Now()) {
+		e.process(event)
+		return nil
+	}
+
+	return e.schedule(event)
+}
+
+// dispatchAt schedules event to run no earlier than t.
+func (e *EventLoop) dispatchAt(t time.Time, event Event) error {
+	event.NotBefore = t
+	event.IsAsync = true
+	return e.dispatch(event)
+}
+
+// dispatchAfter schedules event to run no earlier than d from now.
+func (e *EventLoop) dispatchAfter(d time.Duration, event Event) error {
+	return e.dispatchAt(time.Now().Add(d), event)
+}
+
+// Run starts the scheduler and worker pool and blocks until ctx is cancelled
+// or the loop is stopped directly via Stop, at which point it stops the loop
+// (a no-op if Stop already did) and waits for in-flight events to finish.
+func (e *EventLoop) Run(ctx context.Context) {
+	e.ctxMu.Lock()
+	e.baseCtx = ctx
+	e.ctxMu.Unlock()
+
+	e.wg.Add(1)
+	go e.runScheduler(ctx)
+
+	for i := 0; i < e.opts.Workers; i++ {
+		e.wg.Add(1)
+		go e.worker(ctx)
+	}
+
+	// Signal that every wg.Add above has happened before letting Stop, which
+	// may be running concurrently on another goroutine (the documented
+	// "go loop.Run(ctx); ...; loop.Stop(ctx)" pattern), proceed to wg.Wait.
+	// Without this, Add and Wait race with no happens-before relationship
+	// between them, and Wait can return immediately on a zero counter.
+	e.runOnce.Do(func() { close(e.started) })
+
+	select {
+	case <-ctx.Done():
+	case <-e.stopped:
+	}
+	e.Stop(context.Background())
+}
+
+func (e *EventLoop) worker(ctx context.Context) {
+	defer e.wg.Done()
+	for {
+		select {
+		case event, ok := <-e.ready:
+			if !ok {
+				return
+			}
+			e.process(event)
+		case <-ctx.Done():
+			return
+		case <-e.stopped:
+			return
+		}
+	}
+}
+
+func (e *EventLoop) process(event Event) {
+	e.handlersMu.RLock()
+	handler, exists := e.handlers[event.Key]
+	e.handlersMu.RUnlock()
+	if !exists {
+		e.notifyDrop(event, "no_handler")
+		return
+	}
+
+	e.ctxMu.RLock()
+	ctx := e.baseCtx
+	e.ctxMu.RUnlock()
+
+	e.notifyStart(event)
+	start := time.Now()
+	result, err := handler(ctx, event.Data)
+	dur := time.Since(start)
+
+	errMsg := ""
+	if err != nil {
+		errMsg = err.Error()
+	} else if event.storeID != 0 {
+		if err := e.store.MarkProcessed(event.storeID); err != nil {
+			fmt.Printf("eventloop: failed to mark event %d processed: %s\n", event.storeID, err)
+		}
+	}
+	eventResult := EventResult{Key: event.Key, Result: result, Err: errMsg, Time: time.Now()}
+	e.notifyFinish(eventResult, err, dur)
+	e.publish(eventResult)
+}
+
+// Replay re-runs every stored event with an ID greater than from against the
+// currently registered handlers, regardless of whether it was already
+// processed. It's meant for debugging, not redelivery: it doesn't re-log
+// events to the Store or re-mark them processed.
+func (e *EventLoop) Replay(from uint64) error {
+	stored, err := e.store.All()
+	if err != nil {
+		return fmt.Errorf("eventloop: failed to load history: %w", err)
+	}
+
+	for _, se := range stored {
+		if se.ID <= from {
+			continue
+		}
+		event := se.Event
+		event.storeID = 0
+
+		if !event.IsAsync && !event.NotBefore.After(time.Now()) {
+			e.process(event)
+			continue
+		}
+		if err := e.schedule(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publish stamps result with a monotonically increasing ID, records it in
+// the bounded history and fans it out to the results channel and any live
+// subscribers. History is appended and fanned out to subs under the same
+// lock so a concurrent SubscribeSince can't observe this result twice (once
+// in its snapshot, once on its channel) or miss it entirely.
+func (e *EventLoop) publish(result EventResult) EventResult {
+	e.resultsMu.Lock()
+	e.nextID++
+	result.ID = e.nextID
+	e.history = append(e.history, result)
+	if len(e.history) > e.historyCap {
+		e.history = e.history[len(e.history)-e.historyCap:]
+	}
+	for _, ch := range e.subs {
+		select {
+		case ch <- result:
+		default:
+		}
+	}
+	e.resultsMu.Unlock()
+
+	e.publishResult(result)
+
+	return result
+}
+
+// publishResult hands result to the results channel without blocking the
+// calling worker. Results() is a convenience feed, not a backpressure valve:
+// an embedder that only drives the loop through Subscribe/Since (e.g. Server)
+// never drains it, and a fixed-capacity blocking send there would eventually
+// wedge every worker inside publish. So once the channel is full, the oldest
+// buffered result is dropped to make room, matching the best-effort delivery
+// already used for the subscriber fan-out below.
+func (e *EventLoop) publishResult(result EventResult) {
+	select {
+	case e.results <- result:
+		return
+	default:
+	}
+
+	select {
+	case <-e.results:
+	default:
+	}
+
+	select {
+	case e.results <- result:
+	default:
+	}
+}
+
+// Since returns processed results with an ID greater than since, oldest
+// first, from the bounded in-memory history.
+func (e *EventLoop) Since(since uint64) []EventResult {
+	e.resultsMu.Lock()
+	defer e.resultsMu.Unlock()
+
+	var out []EventResult
+	for _, r := range e.history {
+		if r.ID > since {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Subscribe registers a new listener for processed results and returns a
+// channel of future results plus an unsubscribe func to release it.
+func (e *EventLoop) Subscribe() (<-chan EventResult, func()) {
+	e.resultsMu.Lock()
+	defer e.resultsMu.Unlock()
+	return e.subscribeLocked()
+}
+
+// subscribeLocked registers a new channel under resultsMu and returns it
+// plus an unsubscribe func. Factored out of Subscribe/SubscribeSince so both
+// can register while already holding the lock.
+func (e *EventLoop) subscribeLocked() (<-chan EventResult, func()) {
+	ch := make(chan EventResult, e.opts.QueueSize)
+
+	id := e.nextSub
+	e.nextSub++
+	e.subs[id] = ch
+
+	unsubscribe := func() {
+		e.resultsMu.Lock()
+		delete(e.subs, id)
+		e.resultsMu.Unlock()
+	}
+	return ch, unsubscribe
+}
+
+// SubscribeSince atomically snapshots every result with an ID greater than
+// since and registers a subscription for results published afterwards, so
+// callers that replay history and then stream live updates (e.g. the SSE
+// handler) can't see a result twice or miss one published in between. The
+// two-step Since + Subscribe sequence it replaces has exactly that gap.
+func (e *EventLoop) SubscribeSince(since uint64) (initial []EventResult, ch <-chan EventResult, unsubscribe func()) {
+	e.resultsMu.Lock()
+	defer e.resultsMu.Unlock()
+
+	for _, r := range e.history {
+		if r.ID > since {
+			initial = append(initial, r)
+		}
+	}
+	ch, unsubscribe = e.subscribeLocked()
+	return initial, ch, unsubscribe
+}
+
+// Results returns the channel that processed events are published on. It is
+// a best-effort feed shared by sync and async events alike: if nothing drains
+// it, older results are dropped to make room for new ones rather than
+// blocking the worker pool, so callers that need every result should use
+// Subscribe or Since instead.
+func (e *EventLoop) Results() <-chan EventResult {
+	return e.results
+}
+
+// Stop signals the worker pool to drain and exit, waiting for in-flight
+// events to finish or ctx to expire, whichever comes first.
+func (e *EventLoop) Stop(ctx context.Context) error {
+	e.stopOnce.Do(func() {
+		close(e.stopped)
+		e.heapCond.Broadcast()
+	})
+
+	// Wait for Run to finish registering the scheduler/workers with wg before
+	// calling wg.Wait(): Run's wg.Add calls happen on whatever goroutine runs
+	// Run (commonly `go loop.Run(ctx)`), so without this a concurrent Stop
+	// could call Wait while the counter is still zero and return immediately,
+	// skipping the wait entirely. If Run is never called at all, started
+	// never closes, so callers that only dispatch sync events and never call
+	// Run should pass a ctx with a deadline rather than context.Background().
+	select {
+	case <-e.started:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *EventLoop) produceOutputFor(processedEvent EventResult) {
+	fmt.Printf("Output for Event %q: %v\n\n", processedEvent.Key, processedEvent.Result)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mustDeadlineCtx returns a context that's always cancelled by the end of
+// the test, so a Stop call used only for cleanup can't hang a test forever.
+func mustDeadlineCtx(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestReplayUnprocessedDoesNotDeadlock(t *testing.T) {
+	store := NewMemoryEventStore()
+	for i := 0; i < 5; i++ {
+		if _, err := store.Append(Event{Key: "k", Data: "x"}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+
+	done := make(chan *EventLoop, 1)
+	go func() {
+		done <- NewEventLoopWithOptions(EventLoopOptions{Workers: 1, QueueSize: 2, OnFull: Block, Store: store})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("NewEventLoopWithOptions deadlocked replaying more unprocessed events than QueueSize under OnFull: Block")
+	}
+}
+
+func TestRunStopDirectNoRace(t *testing.T) {
+	loop := NewEventLoopWithOptions(EventLoopOptions{Workers: 2, QueueSize: 4})
+	loop.on("k", func(ctx context.Context, data string) (string, error) { return data, nil })
+
+	go loop.Run(context.Background())
+	for i := 0; i < 10; i++ {
+		loop.dispatch(Event{Key: "k", Data: "x", IsAsync: true})
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- loop.Stop(context.Background()) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Stop returned error: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Stop did not return after Run was started concurrently via go loop.Run(ctx)")
+	}
+}
+
+// TestSubscribeSinceNoDuplicateOrMissed guards the e57e6a9 fix: each
+// individual SubscribeSince call must never see the same result both in its
+// initial replay and again on its channel, even with publishes landing
+// concurrently with the call itself.
+func TestSubscribeSinceNoDuplicateOrMissed(t *testing.T) {
+	loop := NewEventLoopWithOptions(EventLoopOptions{Workers: 4, QueueSize: 64})
+	loop.on("k", func(ctx context.Context, data string) (string, error) { return data, nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go loop.Run(ctx)
+	defer func() {
+		cancel()
+		loop.Stop(mustDeadlineCtx(t))
+	}()
+
+	for i := 0; i < 20; i++ {
+		loop.dispatch(Event{Key: "k", Data: "warm", IsAsync: true})
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	stopDispatching := make(chan struct{})
+	var dispatchWg sync.WaitGroup
+	dispatchWg.Add(1)
+	go func() {
+		defer dispatchWg.Done()
+		for {
+			select {
+			case <-stopDispatching:
+				return
+			default:
+				loop.dispatch(Event{Key: "k", Data: "x", IsAsync: true})
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 200)
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			initial, ch, unsub := loop.SubscribeSince(0)
+			defer unsub()
+
+			seen := make(map[uint64]bool, len(initial))
+			for _, r := range initial {
+				seen[r.ID] = true
+			}
+
+			select {
+			case r := <-ch:
+				if seen[r.ID] {
+					errs <- "channel delivered an ID already present in the initial SubscribeSince snapshot"
+				}
+			case <-time.After(2 * time.Millisecond):
+			}
+		}()
+	}
+	wg.Wait()
+	close(stopDispatching)
+	dispatchWg.Wait()
+
+	select {
+	case msg := <-errs:
+		t.Fatal(msg)
+	default:
+	}
+}
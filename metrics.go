@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Observer receives lifecycle callbacks for every event the loop handles,
+// so embedders can see production behaviour without parsing stdout.
+type Observer interface {
+	OnDispatch(event Event)
+	OnStart(event Event)
+	OnFinish(result EventResult, err error, dur time.Duration)
+	OnDrop(event Event, reason string)
+}
+
+// defaultLatencyBuckets mirrors the bucket boundaries Prometheus client
+// libraries default to for sub-second handler latencies, in seconds.
+var defaultLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// histogram is a Prometheus-style cumulative bucketed histogram: counts[i]
+// is the number of observations <= buckets[i].
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram() *histogram {
+	return &histogram{buckets: defaultLatencyBuckets, counts: make([]uint64, len(defaultLatencyBuckets))}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	secs := d.Seconds()
+	h.sum += secs
+	h.count++
+	for i, bound := range h.buckets {
+		if secs <= bound {
+			h.counts[i]++
+		}
+	}
+}
+
+// quantile linearly interpolates within the bucket the quantile falls in,
+// the same approximation Prometheus' histogram_quantile() uses.
+func (h *histogram) quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	target := q * float64(h.count)
+	var prevBound, prevCount float64
+	for i, count := range h.counts {
+		if float64(count) >= target {
+			bound := h.buckets[i]
+			if count == uint64(prevCount) {
+				return time.Duration(bound * float64(time.Second))
+			}
+			frac := (target - prevCount) / (float64(count) - prevCount)
+			secs := prevBound + frac*(bound-prevBound)
+			return time.Duration(secs * float64(time.Second))
+		}
+		prevBound, prevCount = h.buckets[i], float64(count)
+	}
+	return time.Duration(h.buckets[len(h.buckets)-1] * float64(time.Second))
+}
+
+// KeyStats is a point-in-time snapshot of an event key's observed behaviour.
+type KeyStats struct {
+	Dispatched uint64
+	Completed  uint64
+	Failed     uint64
+	Dropped    uint64
+	ErrorRate  float64
+	P50        time.Duration
+	P95        time.Duration
+}
+
+// MetricsCollector is a built-in Observer that tallies per-key counters and
+// handler-duration histograms, and can render them in Prometheus text
+// exposition format via ServeHTTP.
+type MetricsCollector struct {
+	mu           sync.Mutex
+	dispatched   map[string]uint64
+	completed    map[string]uint64
+	failed       map[string]uint64
+	dropped      map[string]uint64
+	durations    map[string]*histogram
+	queueDepthFn func() int
+}
+
+func NewMetricsCollector() *MetricsCollector {
+	return &MetricsCollector{
+		dispatched: make(map[string]uint64),
+		completed:  make(map[string]uint64),
+		failed:     make(map[string]uint64),
+		dropped:    make(map[string]uint64),
+		durations:  make(map[string]*histogram),
+	}
+}
+
+func (m *MetricsCollector) OnDispatch(event Event) {
+	m.mu.Lock()
+	m.dispatched[event.Key]++
+	m.mu.Unlock()
+}
+
+func (m *MetricsCollector) OnStart(event Event) {}
+
+func (m *MetricsCollector) OnFinish(result EventResult, err error, dur time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err != nil {
+		m.failed[result.Key]++
+	} else {
+		m.completed[result.Key]++
+	}
+	h, ok := m.durations[result.Key]
+	if !ok {
+		h = newHistogram()
+		m.durations[result.Key] = h
+	}
+	h.observe(dur)
+}
+
+func (m *MetricsCollector) OnDrop(event Event, reason string) {
+	m.mu.Lock()
+	m.dropped[event.Key]++
+	m.mu.Unlock()
+}
+
+// setQueueDepthFunc wires in the gauge read for queue_depth; called once by
+// the owning EventLoop at construction time.
+func (m *MetricsCollector) setQueueDepthFunc(fn func() int) {
+	m.mu.Lock()
+	m.queueDepthFn = fn
+	m.mu.Unlock()
+}
+
+// Snapshot returns per-key counters, error rate and latency percentiles.
+func (m *MetricsCollector) Snapshot() map[string]KeyStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make(map[string]struct{})
+	for k := range m.dispatched {
+		keys[k] = struct{}{}
+	}
+	for k := range m.dropped {
+		keys[k] = struct{}{}
+	}
+
+	out := make(map[string]KeyStats, len(keys))
+	for key := range keys {
+		completed := m.completed[key]
+		failed := m.failed[key]
+		total := completed + failed
+		stats := KeyStats{
+			Dispatched: m.dispatched[key],
+			Completed:  completed,
+			Failed:     failed,
+			Dropped:    m.dropped[key],
+		}
+		if total > 0 {
+			stats.ErrorRate = float64(failed) / float64(total)
+		}
+		if h, ok := m.durations[key]; ok {
+			stats.P50 = h.quantile(0.5)
+			stats.P95 = h.quantile(0.95)
+		}
+		out[key] = stats
+	}
+	return out
+}
+
+// ServeHTTP renders the collected metrics in Prometheus text exposition
+// format, suitable for mounting at /metrics.
+func (m *MetricsCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteText(w)
+}
+
+func (m *MetricsCollector) WriteText(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeCounter(w, "eventloop_events_dispatched_total", m.dispatched)
+	writeCounter(w, "eventloop_events_completed_total", m.completed)
+	writeCounter(w, "eventloop_events_failed_total", m.failed)
+	writeCounter(w, "eventloop_events_dropped_total", m.dropped)
+
+	fmt.Fprintln(w, "# TYPE eventloop_handler_duration_seconds histogram")
+	keys := make([]string, 0, len(m.durations))
+	for k := range m.durations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		h := m.durations[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "eventloop_handler_duration_seconds_bucket{key=%q,le=%q} %d\n", key, formatFloat(bound), h.counts[i])
+		}
+		fmt.Fprintf(w, "eventloop_handler_duration_seconds_bucket{key=%q,le=\"+Inf\"} %d\n", key, h.count)
+		fmt.Fprintf(w, "eventloop_handler_duration_seconds_sum{key=%q} %s\n", key, formatFloat(h.sum))
+		fmt.Fprintf(w, "eventloop_handler_duration_seconds_count{key=%q} %d\n", key, h.count)
+	}
+
+	if m.queueDepthFn != nil {
+		fmt.Fprintln(w, "# TYPE eventloop_queue_depth gauge")
+		fmt.Fprintf(w, "eventloop_queue_depth %d\n", m.queueDepthFn())
+	}
+}
+
+func writeCounter(w io.Writer, name string, values map[string]uint64) {
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{key=%q} %d\n", name, key, values[key])
+	}
+}
+
+func formatFloat(f float64) string {
+	return fmt.Sprintf("%g", f)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by a handler wrapped with WithCircuitBreaker
+// while the breaker is tripped.
+var ErrCircuitOpen = errors.New("eventloop: circuit breaker open")
+
+// WithTimeout cancels next's context after d and returns a timeout error
+// instead of letting a slow handler block a worker indefinitely.
+func WithTimeout(d time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, data string) (string, error) {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			type outcome struct {
+				result string
+				err    error
+			}
+			done := make(chan outcome, 1)
+			go func() {
+				result, err := next(ctx, data)
+				done <- outcome{result, err}
+			}()
+
+			select {
+			case o := <-done:
+				return o.result, o.err
+			case <-ctx.Done():
+				return "", fmt.Errorf("handler timed out after %s", d)
+			}
+		}
+	}
+}
+
+// WithRetry re-runs next up to maxAttempts times on error, waiting baseDelay
+// between attempts with exponential backoff (baseDelay, 2*baseDelay, 4*baseDelay, ...).
+func WithRetry(maxAttempts int, baseDelay time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, data string) (string, error) {
+			var lastErr error
+			for attempt := 0; attempt < maxAttempts; attempt++ {
+				if attempt > 0 {
+					delay := baseDelay * time.Duration(1<<uint(attempt-1))
+					select {
+					case <-time.After(delay):
+					case <-ctx.Done():
+						return "", ctx.Err()
+					}
+				}
+
+				result, err := next(ctx, data)
+				if err == nil {
+					return result, nil
+				}
+				lastErr = err
+			}
+			return "", fmt.Errorf("giving up after %d attempts: %w", maxAttempts, lastErr)
+		}
+	}
+}
+
+// WithCircuitBreaker trips after threshold consecutive failures seen within
+// window, short-circuiting next with ErrCircuitOpen for cooldown before
+// allowing another attempt through.
+func WithCircuitBreaker(threshold int, window, cooldown time.Duration) Middleware {
+	var (
+		mu                  sync.Mutex
+		consecutiveFailures int
+		firstFailureAt      time.Time
+		openedAt            time.Time
+		open                bool
+	)
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, data string) (string, error) {
+			mu.Lock()
+			if open {
+				if time.Since(openedAt) < cooldown {
+					mu.Unlock()
+					return "", ErrCircuitOpen
+				}
+				open = false
+				consecutiveFailures = 0
+			}
+			mu.Unlock()
+
+			result, err := next(ctx, data)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if consecutiveFailures == 0 || time.Since(firstFailureAt) > window {
+					firstFailureAt = time.Now()
+					consecutiveFailures = 0
+				}
+				consecutiveFailures++
+				if consecutiveFailures >= threshold {
+					open = true
+					openedAt = time.Now()
+				}
+			} else {
+				consecutiveFailures = 0
+			}
+			return result, err
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"time"
+)
+
+// scheduledEvent is the unit stored in the priority heap: an event plus the
+// dispatch order it arrived in, used to break (NotBefore, Priority) ties.
+type scheduledEvent struct {
+	event Event
+	seq   uint64
+}
+
+// eventHeap orders pending events by NotBefore first, then by highest
+// Priority, then by dispatch order (seq) — a classic min-heap timer wheel.
+type eventHeap []scheduledEvent
+
+func (h eventHeap) Len() int { return len(h) }
+
+func (h eventHeap) Less(i, j int) bool {
+	a, b := h[i].event, h[j].event
+	if !a.NotBefore.Equal(b.NotBefore) {
+		return a.NotBefore.Before(b.NotBefore)
+	}
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h eventHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *eventHeap) Push(x any) {
+	*h = append(*h, x.(scheduledEvent))
+}
+
+func (h *eventHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// schedule places event on the priority heap, applying OnFull when the heap
+// is already at QueueSize capacity.
+func (e *EventLoop) schedule(event Event) error {
+	e.heapMu.Lock()
+
+	if len(e.pending) >= e.opts.QueueSize {
+		switch e.opts.OnFull {
+		case DropNewest:
+			e.heapMu.Unlock()
+			e.notifyDrop(event, "queue_full")
+			return nil
+		case Error:
+			e.heapMu.Unlock()
+			return ErrQueueFull
+		case DropOldest:
+			evicted := e.evictOldestLocked()
+			e.heapMu.Unlock()
+			if evicted != nil {
+				e.notifyDrop(*evicted, "queue_full")
+			}
+			e.heapMu.Lock()
+		default: // Block
+			for len(e.pending) >= e.opts.QueueSize {
+				select {
+				case <-e.stopped:
+					e.heapMu.Unlock()
+					return ErrStopped
+				default:
+				}
+				e.heapCond.Wait()
+			}
+		}
+	}
+
+	e.seq++
+	heap.Push(&e.pending, scheduledEvent{event: event, seq: e.seq})
+	e.heapMu.Unlock()
+
+	e.wakeScheduler()
+	return nil
+}
+
+// scheduleReplay pushes event straight onto the priority heap, ignoring
+// QueueSize and OnFull. It exists only for replayUnprocessed, which runs
+// before Run has started workers to drain the heap; the normal schedule()
+// would block (or drop) on a queue nothing is yet consuming.
+func (e *EventLoop) scheduleReplay(event Event) {
+	e.heapMu.Lock()
+	e.seq++
+	heap.Push(&e.pending, scheduledEvent{event: event, seq: e.seq})
+	e.heapMu.Unlock()
+
+	e.wakeScheduler()
+}
+
+// evictOldestLocked removes and returns the longest-waiting pending event to
+// make room for a new one. Callers must hold heapMu.
+func (e *EventLoop) evictOldestLocked() *Event {
+	if len(e.pending) == 0 {
+		return nil
+	}
+	oldest := 0
+	for i, se := range e.pending {
+		if se.seq < e.pending[oldest].seq {
+			oldest = i
+		}
+	}
+	evicted := heap.Remove(&e.pending, oldest).(scheduledEvent)
+	return &evicted.event
+}
+
+func (e *EventLoop) wakeScheduler() {
+	select {
+	case e.wakeSchedule <- struct{}{}:
+	default:
+	}
+}
+
+// runScheduler pops the next-due, highest-priority event off the heap and
+// hands it to the worker pool, sleeping on a timer reset whenever a sooner
+// event is scheduled in the meantime.
+func (e *EventLoop) runScheduler(ctx context.Context) {
+	defer e.wg.Done()
+
+	timer := time.NewTimer(time.Hour)
+	if !timer.Stop() {
+		<-timer.C
+	}
+
+	for {
+		e.heapMu.Lock()
+		if len(e.pending) == 0 {
+			e.heapMu.Unlock()
+			select {
+			case <-e.wakeSchedule:
+				continue
+			case <-ctx.Done():
+				return
+			case <-e.stopped:
+				return
+			}
+		}
+
+		next := e.pending[0]
+		wait := time.Until(next.event.NotBefore)
+		if wait <= 0 {
+			heap.Pop(&e.pending)
+			e.heapMu.Unlock()
+			e.heapCond.Broadcast()
+
+			select {
+			case e.ready <- next.event:
+			case <-ctx.Done():
+				return
+			case <-e.stopped:
+				return
+			}
+			continue
+		}
+		e.heapMu.Unlock()
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-timer.C:
+		case <-e.wakeSchedule:
+		case <-ctx.Done():
+			return
+		case <-e.stopped:
+			return
+		}
+	}
+}
+
+// Ticker dispatches an event for key/data every interval, re-scheduling
+// itself through dispatchAfter each time it fires, until stop is called.
+func (e *EventLoop) Ticker(key string, interval time.Duration, data string) (stop func()) {
+	done := make(chan struct{})
+
+	var tick func()
+	tick = func() {
+		select {
+		case <-done:
+			return
+		case <-e.stopped:
+			return
+		default:
+		}
+		e.dispatchAfter(interval, Event{Key: key, Data: data})
+		time.AfterFunc(interval, tick)
+	}
+	tick()
+
+	return func() { close(done) }
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"container/heap"
+	"testing"
+	"time"
+)
+
+func TestEventHeapOrdering(t *testing.T) {
+	now := time.Now()
+	h := &eventHeap{}
+
+	heap.Push(h, scheduledEvent{event: Event{Key: "low-pri", NotBefore: now, Priority: 1}, seq: 1})
+	heap.Push(h, scheduledEvent{event: Event{Key: "high-pri", NotBefore: now, Priority: 5}, seq: 2})
+	heap.Push(h, scheduledEvent{event: Event{Key: "delayed", NotBefore: now.Add(time.Hour), Priority: 9}, seq: 3})
+	heap.Push(h, scheduledEvent{event: Event{Key: "same-pri-earlier-seq", NotBefore: now, Priority: 5}, seq: 0})
+
+	var order []string
+	for h.Len() > 0 {
+		order = append(order, heap.Pop(h).(scheduledEvent).event.Key)
+	}
+
+	want := []string{"same-pri-earlier-seq", "high-pri", "low-pri", "delayed"}
+	if len(order) != len(want) {
+		t.Fatalf("order = %v, want %v", order, want)
+	}
+	for i, key := range want {
+		if order[i] != key {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+	}
+}
+
+func TestScheduleOnFullDropNewest(t *testing.T) {
+	e := NewEventLoopWithOptions(EventLoopOptions{Workers: 1, QueueSize: 1, OnFull: DropNewest})
+
+	if err := e.schedule(Event{Key: "first"}); err != nil {
+		t.Fatalf("schedule(first): %v", err)
+	}
+	if err := e.schedule(Event{Key: "second"}); err != nil {
+		t.Fatalf("schedule(second) should be silently dropped, not error: %v", err)
+	}
+
+	if n := e.QueueDepth(); n != 1 {
+		t.Fatalf("QueueDepth() = %d, want 1 (second event should have been dropped)", n)
+	}
+}
+
+func TestScheduleOnFullDropOldest(t *testing.T) {
+	e := NewEventLoopWithOptions(EventLoopOptions{Workers: 1, QueueSize: 1, OnFull: DropOldest})
+
+	if err := e.schedule(Event{Key: "first"}); err != nil {
+		t.Fatalf("schedule(first): %v", err)
+	}
+	if err := e.schedule(Event{Key: "second"}); err != nil {
+		t.Fatalf("schedule(second): %v", err)
+	}
+
+	e.heapMu.Lock()
+	defer e.heapMu.Unlock()
+	if len(e.pending) != 1 || e.pending[0].event.Key != "second" {
+		t.Fatalf("pending = %+v, want only \"second\" (oldest should have been evicted)", e.pending)
+	}
+}
+
+func TestScheduleOnFullError(t *testing.T) {
+	e := NewEventLoopWithOptions(EventLoopOptions{Workers: 1, QueueSize: 1, OnFull: Error})
+
+	if err := e.schedule(Event{Key: "first"}); err != nil {
+		t.Fatalf("schedule(first): %v", err)
+	}
+	if err := e.schedule(Event{Key: "second"}); err != ErrQueueFull {
+		t.Fatalf("schedule(second) = %v, want ErrQueueFull", err)
+	}
+}
+
+func TestScheduleOnFullBlockUnblocksOnDrain(t *testing.T) {
+	e := NewEventLoopWithOptions(EventLoopOptions{Workers: 1, QueueSize: 1, OnFull: Block})
+
+	if err := e.schedule(Event{Key: "first"}); err != nil {
+		t.Fatalf("schedule(first): %v", err)
+	}
+
+	blocked := make(chan error, 1)
+	go func() { blocked <- e.schedule(Event{Key: "second"}) }()
+
+	select {
+	case <-blocked:
+		t.Fatal("schedule(second) returned before the queue had room")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	e.heapMu.Lock()
+	heap.Pop(&e.pending)
+	e.heapMu.Unlock()
+	e.heapCond.Broadcast()
+
+	select {
+	case err := <-blocked:
+		if err != nil {
+			t.Fatalf("schedule(second) = %v, want nil once room freed up", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("schedule(second) never unblocked after the queue drained")
+	}
+}
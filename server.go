@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// longPollTimeout bounds how long GET /events?since= waits for a new result
+// before returning an empty response.
+const longPollTimeout = 25 * time.Second
+
+// Server exposes an EventLoop over HTTP so other services can drive it
+// without importing the Go package: dispatch events via POST, and read
+// results back via polling or a Server-Sent Events stream.
+type Server struct {
+	loop *EventLoop
+}
+
+func NewServer(loop *EventLoop) *Server {
+	return &Server{loop: loop}
+}
+
+// Handler returns the http.Handler serving the event ingress and
+// subscription endpoints.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", s.handleEvents)
+	mux.HandleFunc("/events/stream", s.handleStream)
+	mux.Handle("/metrics", s.loop.metrics)
+	return mux
+}
+
+type dispatchRequest struct {
+	Key     string `json:"key"`
+	Data    string `json:"data"`
+	IsAsync bool   `json:"isAsync"`
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.postEvent(w, r)
+	case http.MethodGet:
+		s.getEvents(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) postEvent(w http.ResponseWriter, r *http.Request) {
+	var req dispatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Key == "" {
+		http.Error(w, "key is required", http.StatusBadRequest)
+		return
+	}
+
+	err := s.loop.dispatch(Event{Key: req.Key, Data: req.Data, IsAsync: req.IsAsync})
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusAccepted)
+	case ErrQueueFull:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case ErrStopped:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// getEvents implements a long-poll feed: it returns immediately with any
+// results newer than since, or waits up to longPollTimeout for one to show
+// up before responding with an empty array.
+func (s *Server) getEvents(w http.ResponseWriter, r *http.Request) {
+	since, err := parseSince(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results, ch, unsubscribe := s.loop.SubscribeSince(since)
+	defer unsubscribe()
+
+	if len(results) == 0 {
+		select {
+		case result := <-ch:
+			results = append(results, result)
+		case <-time.After(longPollTimeout):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	since, err := parseSince(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	initial, ch, unsubscribe := s.loop.SubscribeSince(since)
+	defer unsubscribe()
+
+	for _, result := range initial {
+		writeSSEEvent(w, result)
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case result := <-ch:
+			writeSSEEvent(w, result)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeSSEEvent(w http.ResponseWriter, result EventResult) {
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	w.Write([]byte("data: "))
+	w.Write(payload)
+	w.Write([]byte("\n\n"))
+}
+
+func parseSince(r *http.Request) (uint64, error) {
+	raw := r.URL.Query().Get("since")
+	if raw == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(raw, 10, 64)
+}
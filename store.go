@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// StoredEvent pairs a durably logged Event with the ID it was assigned on Append.
+type StoredEvent struct {
+	ID    uint64
+	Event Event
+}
+
+// EventStore durably logs dispatched events so they survive a process
+// restart and can be delivered at least once, even if the process dies
+// mid-flight.
+type EventStore interface {
+	// Append durably logs event and returns the ID it was assigned.
+	Append(event Event) (uint64, error)
+	// MarkProcessed records that the event with the given ID finished
+	// successfully and should not be replayed again.
+	MarkProcessed(id uint64) error
+	// Unprocessed returns every logged event that hasn't been marked
+	// processed yet, oldest first.
+	Unprocessed() ([]StoredEvent, error)
+	// All returns every logged event regardless of processed state, oldest
+	// first. It backs EventLoop.Replay, which re-runs history for debugging.
+	All() ([]StoredEvent, error)
+}
+
+// MemoryEventStore is an EventStore that keeps its log in memory. Events do
+// not survive a process restart.
+type MemoryEventStore struct {
+	mu        sync.Mutex
+	nextID    uint64
+	order     []uint64
+	events    map[uint64]Event
+	processed map[uint64]bool
+}
+
+func NewMemoryEventStore() *MemoryEventStore {
+	return &MemoryEventStore{
+		events:    make(map[uint64]Event),
+		processed: make(map[uint64]bool),
+	}
+}
+
+func (s *MemoryEventStore) Append(event Event) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	id := s.nextID
+	s.events[id] = event
+	s.order = append(s.order, id)
+	return id, nil
+}
+
+func (s *MemoryEventStore) MarkProcessed(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.processed[id] = true
+	return nil
+}
+
+func (s *MemoryEventStore) Unprocessed() ([]StoredEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []StoredEvent
+	for _, id := range s.order {
+		if !s.processed[id] {
+			out = append(out, StoredEvent{ID: id, Event: s.events[id]})
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryEventStore) All() ([]StoredEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]StoredEvent, 0, len(s.order))
+	for _, id := range s.order {
+		out = append(out, StoredEvent{ID: id, Event: s.events[id]})
+	}
+	return out, nil
+}
+
+// fileLogLine is one line of a FileEventStore's JSON-lines log.
+type fileLogLine struct {
+	Type  string `json:"type"`
+	ID    uint64 `json:"id"`
+	Event *Event `json:"event,omitempty"`
+}
+
+// FileEventStore is an EventStore backed by an append-only JSON-lines file,
+// so logged events survive a process restart and can be replayed.
+type FileEventStore struct {
+	mu        sync.Mutex
+	file      *os.File
+	nextID    uint64
+	events    map[uint64]Event
+	order     []uint64
+	processed map[uint64]bool
+}
+
+func NewFileEventStore(path string) (*FileEventStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileEventStore{
+		file:      file,
+		events:    make(map[uint64]Event),
+		processed: make(map[uint64]bool),
+	}
+	if err := s.replay(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// replay reads the log from the start to rebuild in-memory state, then
+// seeks to the end so subsequent writes append.
+func (s *FileEventStore) replay() error {
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(s.file)
+	for scanner.Scan() {
+		var line fileLogLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			continue
+		}
+		switch line.Type {
+		case "append":
+			if line.Event != nil {
+				s.events[line.ID] = *line.Event
+				s.order = append(s.order, line.ID)
+			}
+			if line.ID > s.nextID {
+				s.nextID = line.ID
+			}
+		case "processed":
+			s.processed[line.ID] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	_, err := s.file.Seek(0, io.SeekEnd)
+	return err
+}
+
+func (s *FileEventStore) writeLine(line fileLogLine) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = s.file.Write(data)
+	return err
+}
+
+func (s *FileEventStore) Append(event Event) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	id := s.nextID
+	if err := s.writeLine(fileLogLine{Type: "append", ID: id, Event: &event}); err != nil {
+		return 0, err
+	}
+	s.events[id] = event
+	s.order = append(s.order, id)
+	return id, nil
+}
+
+func (s *FileEventStore) MarkProcessed(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.writeLine(fileLogLine{Type: "processed", ID: id}); err != nil {
+		return err
+	}
+	s.processed[id] = true
+	return nil
+}
+
+func (s *FileEventStore) Unprocessed() ([]StoredEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []StoredEvent
+	for _, id := range s.order {
+		if !s.processed[id] {
+			out = append(out, StoredEvent{ID: id, Event: s.events[id]})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (s *FileEventStore) All() ([]StoredEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]StoredEvent, 0, len(s.order))
+	for _, id := range s.order {
+		out = append(out, StoredEvent{ID: id, Event: s.events[id]})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (s *FileEventStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFileEventStoreReplayAcrossRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+
+	store, err := NewFileEventStore(path)
+	if err != nil {
+		t.Fatalf("NewFileEventStore: %v", err)
+	}
+
+	var ids []uint64
+	for i := 0; i < 3; i++ {
+		id, err := store.Append(Event{Key: "k", Data: "x"})
+		if err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := store.MarkProcessed(ids[0]); err != nil {
+		t.Fatalf("MarkProcessed: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Simulate a process restart: reopen the same log file.
+	restarted, err := NewFileEventStore(path)
+	if err != nil {
+		t.Fatalf("NewFileEventStore (restart): %v", err)
+	}
+	defer restarted.Close()
+
+	all, err := restarted.All()
+	if err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("All() returned %d events, want 3", len(all))
+	}
+
+	unprocessed, err := restarted.Unprocessed()
+	if err != nil {
+		t.Fatalf("Unprocessed: %v", err)
+	}
+	if len(unprocessed) != 2 {
+		t.Fatalf("Unprocessed() returned %d events, want 2 (ids[0] was marked processed before restart)", len(unprocessed))
+	}
+	for _, se := range unprocessed {
+		if se.ID == ids[0] {
+			t.Fatalf("Unprocessed() still includes id %d, which was marked processed before restart", ids[0])
+		}
+	}
+
+	// A further MarkProcessed after restart must also persist.
+	if err := restarted.MarkProcessed(ids[1]); err != nil {
+		t.Fatalf("MarkProcessed after restart: %v", err)
+	}
+	unprocessed, err = restarted.Unprocessed()
+	if err != nil {
+		t.Fatalf("Unprocessed: %v", err)
+	}
+	if len(unprocessed) != 1 || unprocessed[0].ID != ids[2] {
+		t.Fatalf("Unprocessed() = %+v, want only id %d", unprocessed, ids[2])
+	}
+}